@@ -0,0 +1,58 @@
+// Command whclient exposes a local backend URL through a webhooktunnel
+// proxy, turning a raw tunnel into an "expose localhost to the world" tool
+// without writing any Go glue.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/taskcluster/webhooktunnel/whclient"
+)
+
+func main() {
+	var (
+		proxyAddr          = flag.String("proxy", "", "address of the webhooktunnel proxy (required)")
+		id                 = flag.String("id", "", "client id to register with the proxy (required)")
+		token              = flag.String("token", "", "bearer token used to authenticate with the proxy (required)")
+		backend            = flag.String("backend", "", "backend URL to proxy requests to, e.g. http://localhost:8080 or unix:///var/run/app.sock (required)")
+		hostHeader         = flag.String("host-header", "", "override the Host header sent to the backend")
+		insecureSkipVerify = flag.Bool("insecure-skip-verify", false, "skip TLS certificate verification when the backend uses https")
+		requestTimeout     = flag.Duration("request-timeout", 0, "timeout for a single proxied request, 0 for no timeout")
+	)
+	flag.Parse()
+
+	if *proxyAddr == "" || *id == "" || *token == "" || *backend == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := log.New(os.Stderr, "whclient: ", log.LstdFlags)
+
+	configurer := func() (whclient.Config, error) {
+		return whclient.Config{
+			ID:        *id,
+			ProxyAddr: *proxyAddr,
+			Token:     *token,
+			Logger:    logger,
+		}, nil
+	}
+
+	err := whclient.Serve(*backend, whclient.ServeOptions{
+		Configurer:         configurer,
+		HostHeader:         *hostHeader,
+		InsecureSkipVerify: *insecureSkipVerify,
+		RequestTimeout:     *requestTimeout,
+		AccessLog: func(entry whclient.AccessLogEntry) {
+			if entry.Err != nil {
+				logger.Printf("%s %s -> error: %v (%s)", entry.Method, entry.Path, entry.Err, entry.Duration)
+				return
+			}
+			logger.Printf("%s %s -> %d (%s)", entry.Method, entry.Path, entry.StatusCode, entry.Duration)
+		},
+	})
+	if err != nil {
+		logger.Fatalf("serve failed: %v", err)
+	}
+}
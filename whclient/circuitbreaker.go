@@ -0,0 +1,97 @@
+package whclient
+
+import (
+	"sync"
+	"time"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops Client from repeatedly dialing a proxy that keeps
+// rejecting it outright (bad credentials, a permanently misconfigured
+// client id) instead of retrying forever.
+type circuitBreaker struct {
+	mu sync.Mutex
+
+	cfg CircuitBreakerConfig
+
+	state       circuitState
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg}
+}
+
+// allow reports whether a dial attempt may proceed. While the circuit is
+// open, it returns false until CooldownPeriod has elapsed, at which point
+// it transitions to half-open and allows exactly one probe through.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if time.Since(cb.openedAt) < cb.cfg.CooldownPeriod {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// a probe is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// isOpen reports whether the circuit is currently open and still within
+// its cooldown, without consuming the half-open probe slot. Used by Accept
+// to report ErrCircuitOpen without triggering a reconnect attempt.
+func (cb *circuitBreaker) isOpen() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state == circuitOpen && time.Since(cb.openedAt) < cb.cfg.CooldownPeriod
+}
+
+// recordSuccess closes the circuit and resets the failure streak.
+func (cb *circuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.state = circuitClosed
+	cb.failures = 0
+}
+
+// recordFailure counts a non-retryable failure, opening the circuit once
+// FailureThreshold consecutive failures land within Window. A failed
+// half-open probe re-opens the circuit immediately.
+func (cb *circuitBreaker) recordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == circuitHalfOpen {
+		cb.state = circuitOpen
+		cb.openedAt = time.Now()
+		cb.failures = 0
+		return
+	}
+
+	now := time.Now()
+	if cb.failures == 0 || now.Sub(cb.windowStart) > cb.cfg.Window {
+		cb.windowStart = now
+		cb.failures = 0
+	}
+	cb.failures++
+	if cb.failures >= cb.cfg.FailureThreshold {
+		cb.state = circuitOpen
+		cb.openedAt = now
+	}
+}
@@ -0,0 +1,115 @@
+package whclient
+
+import (
+	"testing"
+	"time"
+)
+
+func testBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: 3,
+		Window:           time.Minute,
+		CooldownPeriod:   10 * time.Millisecond,
+	}.defaultValues()
+}
+
+func TestCircuitBreakerAllowsByDefault(t *testing.T) {
+	cb := newCircuitBreaker(testBreakerConfig())
+	if !cb.allow() {
+		t.Fatal("allow() = false, want true for a fresh circuit breaker")
+	}
+	if cb.isOpen() {
+		t.Fatal("isOpen() = true, want false for a fresh circuit breaker")
+	}
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	cfg := testBreakerConfig()
+	cb := newCircuitBreaker(cfg)
+
+	for i := 0; i < cfg.FailureThreshold-1; i++ {
+		cb.recordFailure()
+		if cb.isOpen() {
+			t.Fatalf("isOpen() = true after %d failures, want false (threshold is %d)", i+1, cfg.FailureThreshold)
+		}
+	}
+	cb.recordFailure()
+	if !cb.isOpen() {
+		t.Fatalf("isOpen() = false after %d failures, want true", cfg.FailureThreshold)
+	}
+	if cb.allow() {
+		t.Fatal("allow() = true while circuit is open and within cooldown")
+	}
+}
+
+func TestCircuitBreakerWindowResetsStaleFailures(t *testing.T) {
+	cfg := testBreakerConfig()
+	cfg.Window = time.Millisecond
+	cb := newCircuitBreaker(cfg)
+
+	cb.recordFailure()
+	cb.recordFailure()
+	time.Sleep(5 * time.Millisecond)
+	cb.recordFailure()
+
+	if cb.isOpen() {
+		t.Fatal("isOpen() = true, want false: the first two failures fell outside Window and should not count")
+	}
+}
+
+func TestCircuitBreakerHalfOpenAfterCooldown(t *testing.T) {
+	cfg := testBreakerConfig()
+	cb := newCircuitBreaker(cfg)
+	for i := 0; i < cfg.FailureThreshold; i++ {
+		cb.recordFailure()
+	}
+	if !cb.isOpen() {
+		t.Fatal("circuit did not open after FailureThreshold failures")
+	}
+
+	time.Sleep(cfg.CooldownPeriod * 2)
+
+	if !cb.allow() {
+		t.Fatal("allow() = false after CooldownPeriod elapsed, want true for the half-open probe")
+	}
+	if cb.allow() {
+		t.Fatal("allow() = true for a second probe while the first half-open probe is still in flight")
+	}
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	cfg := testBreakerConfig()
+	cb := newCircuitBreaker(cfg)
+	for i := 0; i < cfg.FailureThreshold; i++ {
+		cb.recordFailure()
+	}
+	time.Sleep(cfg.CooldownPeriod * 2)
+	if !cb.allow() {
+		t.Fatal("allow() = false, want true to let the half-open probe through")
+	}
+
+	cb.recordFailure()
+	if !cb.isOpen() {
+		t.Fatal("isOpen() = false after a failed half-open probe, want true: it should re-open immediately")
+	}
+}
+
+func TestCircuitBreakerSuccessCloses(t *testing.T) {
+	cfg := testBreakerConfig()
+	cb := newCircuitBreaker(cfg)
+	for i := 0; i < cfg.FailureThreshold; i++ {
+		cb.recordFailure()
+	}
+	time.Sleep(cfg.CooldownPeriod * 2)
+	if !cb.allow() {
+		t.Fatal("allow() = false, want true to let the half-open probe through")
+	}
+
+	cb.recordSuccess()
+	if cb.isOpen() {
+		t.Fatal("isOpen() = true after recordSuccess, want false")
+	}
+	if !cb.allow() {
+		t.Fatal("allow() = false on a closed circuit, want true")
+	}
+}
@@ -3,11 +3,11 @@ package whclient
 import (
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/taskcluster/webhooktunnel/util"
 	"github.com/taskcluster/webhooktunnel/wsmux"
 )
@@ -27,8 +27,55 @@ type Config struct {
 	Token     string
 	Retry     RetryConfig
 	Logger    util.Logger
+
+	// KeepAliveInterval is the period between websocket ping frames sent
+	// to the proxy while a session is active. Defaults to
+	// defaultKeepAliveInterval if zero.
+	KeepAliveInterval time.Duration
+
+	// KeepAliveTimeout is how long Client waits for a pong in response to
+	// a ping before treating the connection as dead and reconnecting.
+	// Defaults to defaultKeepAliveTimeout if zero.
+	KeepAliveTimeout time.Duration
+
+	// Transport selects how Client dials the proxy: TransportWebsocket
+	// (the default) or TransportKCP. Configurer may also return
+	// transport-specific options alongside this, e.g. KCP.
+	Transport string
+
+	// KCP holds options for the KCP transport. Only used when
+	// Transport == TransportKCP.
+	KCP KCPOptions
+
+	// OnEvent, if set, is called for every connection lifecycle
+	// transition (dialing, connected, retrying, reconnected, broken,
+	// closed), as a typed alternative to parsing Logger output.
+	OnEvent func(Event)
+
+	// TransportWrapper, if set, wraps the selected Transport before it is
+	// used to dial, e.g. to instrument it with whmetrics byte counters.
+	TransportWrapper func(Transport) Transport
 }
 
+const (
+	defaultKeepAliveInterval = 30 * time.Second
+	defaultKeepAliveTimeout  = 10 * time.Second
+)
+
+// reconnectTokenHeader is the header used to carry an opaque token the proxy
+// can use to recognize that a new dial belongs to a client it already knows
+// about. Client echoes back whatever value the proxy last handed it in this
+// same header.
+//
+// NOTE: this is scaffolding only. Client always builds a brand new
+// wsmux.Session on every (re)connect (see reconnect below), so no in-flight
+// stream survives today regardless of whether the proxy recognizes the
+// token. Real session resumption - replaying unacked frames via per-stream
+// sequence numbers and a RESUME handshake - needs support from the wsmux
+// package itself, which isn't present in this tree; this header is plumbed
+// ahead of that so the proxy side can be built against it first.
+const reconnectTokenHeader = "x-webhooktunnel-reconnect-token"
+
 // Configurer is a function which can generate a Config object
 // to be used by the client
 type Configurer func() (Config, error)
@@ -36,18 +83,27 @@ type Configurer func() (Config, error)
 // Client used to connect to a proxy instance and serve content
 // over the proxy. Client implements net.Listener.
 type Client struct {
-	m          sync.Mutex
-	id         string
-	proxyAddr  string
-	token      string
-	url        atomic.Value
-	retry      RetryConfig
-	logger     util.Logger
-	configurer Configurer
-	session    *wsmux.Session
-	state      clientState
-	closed     chan struct{}
-	acceptErr  net.Error
+	m                 sync.Mutex
+	id                string
+	proxyAddr         string
+	token             string
+	url               atomic.Value
+	retry             RetryConfig
+	logger            util.Logger
+	configurer        Configurer
+	session           *wsmux.Session
+	state             clientState
+	closed            chan struct{}
+	acceptErr         net.Error
+	keepAliveInterval time.Duration
+	keepAliveTimeout  time.Duration
+	lastPong          atomic.Value
+	stopHeartbeat     chan struct{}
+	reconnectToken    atomic.Value // string
+	transport         Transport
+	onEvent           func(Event)
+	breaker           *circuitBreaker
+	reconnecting      bool
 }
 
 // New creates a new Client instance.
@@ -58,14 +114,18 @@ func New(configurer Configurer) (*Client, error) {
 	}
 
 	cl := &Client{configurer: configurer}
-	cl.setConfig(config)
+	if err := cl.setConfig(config); err != nil {
+		return nil, err
+	}
 	cl.closed = make(chan struct{}, 1)
-	conn, url, err := cl.connectWithRetry()
+	conn, url, attempt, err := cl.connectWithRetry()
 	if err != nil {
 		return nil, err
 	}
 	cl.url.Store(url)
 	cl.session = wsmux.Client(conn, wsmux.Config{})
+	cl.startHeartbeat(conn)
+	cl.emit(Event{Kind: EventConnected, Attempt: attempt, RemoteURL: url})
 	return cl, nil
 }
 
@@ -86,7 +146,19 @@ func (c *Client) Accept() (net.Conn, error) {
 
 	c.m.Lock()
 	defer c.m.Unlock()
-	if c.state == stateBroken || c.state == stateClosed {
+	if c.state == stateBroken {
+		if c.breaker.isOpen() {
+			return nil, ErrCircuitOpen
+		}
+		// The circuit is closed or its cooldown has elapsed, but the
+		// reconnect goroutine that last ran only fires once per break
+		// event. Make sure one is in flight so a half-open probe (or a
+		// plain retry, if the breaker never opened) actually happens
+		// instead of Accept repeating the same cached error forever.
+		c.maybeReconnectLocked()
+		return nil, c.acceptErr
+	}
+	if c.state == stateClosed {
 		return nil, c.acceptErr
 	}
 
@@ -94,12 +166,23 @@ func (c *Client) Accept() (net.Conn, error) {
 	if err != nil {
 		c.state = stateBroken
 		c.acceptErr = ErrClientReconnecting
-		go c.reconnect()
+		c.emit(Event{Kind: EventBroken, RemoteURL: c.proxyAddr, Err: err})
+		c.maybeReconnectLocked()
 		return nil, c.acceptErr
 	}
 	return stream, nil
 }
 
+// maybeReconnectLocked starts a reconnect attempt unless one is already in
+// flight. Callers must hold c.m.
+func (c *Client) maybeReconnectLocked() {
+	if c.reconnecting {
+		return
+	}
+	c.reconnecting = true
+	go c.reconnect()
+}
+
 // Addr returns the net.Addr of the underlying wsmux session
 func (c *Client) Addr() net.Addr {
 	return c.session.Addr()
@@ -116,90 +199,163 @@ func (c *Client) Close() error {
 			c.m.Lock()
 			defer c.m.Unlock()
 			c.acceptErr = ErrClientClosed
+			c.stopHeartbeatLocked()
 			_ = c.session.Close()
+			c.emit(Event{Kind: EventClosed, RemoteURL: c.proxyAddr})
 		}()
 	}
 	return nil
 }
 
-func (c *Client) setConfig(config Config) {
+func (c *Client) setConfig(config Config) error {
 	c.id = config.ID
-	c.proxyAddr = util.MakeWsURL(config.ProxyAddr)
 	c.token = config.Token
+	c.onEvent = config.OnEvent
+
+	transport, err := newTransport(config)
+	if err != nil {
+		return err
+	}
+	// Check the transport kind before TransportWrapper (e.g.
+	// whmetrics.WrapTransport) wraps it in another Transport implementation;
+	// otherwise this type switch always misses once a wrapper is in play.
+	if _, ok := transport.(*wsTransport); ok {
+		c.proxyAddr = util.MakeWsURL(config.ProxyAddr)
+	} else {
+		c.proxyAddr = config.ProxyAddr
+	}
+	if config.TransportWrapper != nil {
+		transport = config.TransportWrapper(transport)
+	}
+	c.transport = transport
 
 	c.retry = config.Retry.defaultValues()
+	if c.breaker == nil {
+		c.breaker = newCircuitBreaker(c.retry.CircuitBreaker)
+	}
 	c.logger = config.Logger
 	if c.logger == nil {
 		c.logger = &util.NilLogger{}
 	}
+
+	c.keepAliveInterval = config.KeepAliveInterval
+	if c.keepAliveInterval <= 0 {
+		c.keepAliveInterval = defaultKeepAliveInterval
+	}
+	c.keepAliveTimeout = config.KeepAliveTimeout
+	if c.keepAliveTimeout <= 0 {
+		c.keepAliveTimeout = defaultKeepAliveTimeout
+	}
+	return nil
 }
 
-// connectWithRetry returns a websocket connection to the proxy
-func (c *Client) connectWithRetry() (*websocket.Conn, string, error) {
+// connectWithRetry returns a connection to the proxy, dialed over whichever
+// Transport is configured, along with the number of dial attempts it took.
+func (c *Client) connectWithRetry() (MuxConn, string, int, error) {
 	// if token is expired or not usable, get a new token from the authorizer
 	if !util.IsTokenUsable(c.token) {
 		config, err := c.configurer()
 		if err != nil {
-			return nil, "", ErrRetryFailed
+			return nil, "", 0, ErrRetryFailed
+		}
+		if err := c.setConfig(config); err != nil {
+			return nil, "", 0, ErrRetryFailed
 		}
-		c.setConfig(config)
 	}
 
 	// initial connection
-	header := make(http.Header)
-	header.Set("Authorization", "Bearer "+c.token)
-	header.Set("x-webhooktunnel-id", c.id)
+	header := c.dialHeader()
 	// initial attempt
 	c.logger.Printf("trying to connect to %s", c.proxyAddr)
-	conn, res, err := websocket.DefaultDialer.Dial(c.proxyAddr, header)
+	c.emit(Event{Kind: EventDialing, Attempt: 1, RemoteURL: c.proxyAddr})
+	conn, info, err := c.transport.Dial(c.proxyAddr, header)
 	if err != nil {
-		if shouldRetry(res) {
+		if shouldRetry(info) {
 			// retry connection and return result
 			return c.retryConn()
 		}
-		c.logger.Printf("connection failed with error:%v, response:%v", err, res)
-		if isAuthError(res) {
-			return nil, "", ErrAuthFailed
+		c.logger.Printf("connection failed with error:%v, response:%v", err, info)
+		if isAuthError(info) {
+			c.emit(Event{Kind: EventAuthFailed, Attempt: 1, RemoteURL: c.proxyAddr, Err: err})
+			return nil, "", 1, ErrAuthFailed
 		}
-		return nil, "", ErrRetryFailed
+		return nil, "", 1, ErrRetryFailed
 	}
 	c.logger.Printf("connected to %s ", c.proxyAddr)
+	c.storeReconnectToken(info)
 
-	url := res.Header.Get("x-webhooktunnel-client-url")
-	return conn, url, err
+	url := info.Header.Get("x-webhooktunnel-client-url")
+	return conn, url, 1, err
+}
+
+// dialHeader builds the request header sent with every dial attempt,
+// including the reconnect token from a previous session if one is held.
+// This identifies the dial to the proxy as belonging to an existing client;
+// it does not by itself preserve any in-flight stream (see
+// reconnectTokenHeader's doc comment).
+func (c *Client) dialHeader() http.Header {
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer "+c.token)
+	header.Set("x-webhooktunnel-id", c.id)
+	if token, ok := c.reconnectToken.Load().(string); ok && token != "" {
+		header.Set(reconnectTokenHeader, token)
+	}
+	return header
+}
+
+// storeReconnectToken records the resume token the proxy returned with a
+// successful dial, if any, for use on the next reconnect attempt.
+func (c *Client) storeReconnectToken(info *DialInfo) {
+	if info == nil || info.Header == nil {
+		return
+	}
+	if token := info.Header.Get(reconnectTokenHeader); token != "" {
+		c.reconnectToken.Store(token)
+	}
 }
 
 // retryConn is a utility function used by connectWithRetry to use exponential
 // backoff to attempt reconnection
-func (c *Client) retryConn() (*websocket.Conn, string, error) {
+func (c *Client) retryConn() (MuxConn, string, int, error) {
 	// at this point, proxy should return proxyAddr like ws://register.domain.ext
 
-	header := make(http.Header)
-	header.Set("Authorization", "Bearer "+c.token)
-	header.Set("x-webhooktunnel-id", c.id)
+	header := c.dialHeader()
 
-	currentDelay := c.retry.InitialDelay
+	start := time.Now()
+	attempt := 1
+	currentDelay := c.retry.initialBackoff()
 	maxTimer := time.After(c.retry.MaxElapsedTime)
 	backoff := time.After(currentDelay)
 
 	for {
 		select {
 		case <-maxTimer:
-			return nil, "", ErrRetryTimedOut
+			return nil, "", attempt, ErrRetryTimedOut
 		case <-backoff:
+			attempt++
 			c.logger.Printf("trying to connect to %s", c.proxyAddr)
-			conn, res, err := websocket.DefaultDialer.Dial(c.proxyAddr, header)
+			c.emit(Event{Kind: EventDialing, Attempt: attempt, RemoteURL: c.proxyAddr, Elapsed: time.Since(start)})
+			conn, info, err := c.transport.Dial(c.proxyAddr, header)
 			if err == nil {
-				url := res.Header.Get("x-webhooktunnel-client-url")
-				return conn, url, nil
+				c.storeReconnectToken(info)
+				url := info.Header.Get("x-webhooktunnel-client-url")
+				return conn, url, attempt, nil
 			}
-			if !shouldRetry(res) {
+			if !shouldRetry(info) {
 				c.logger.Printf("connection to %s failed. could not connect", c.proxyAddr)
-				return nil, "", ErrRetryFailed
+				if isAuthError(info) {
+					c.emit(Event{Kind: EventAuthFailed, Attempt: attempt, RemoteURL: c.proxyAddr, Elapsed: time.Since(start), Err: err})
+					return nil, "", attempt, ErrAuthFailed
+				}
+				return nil, "", attempt, ErrRetryFailed
 			}
 			c.logger.Printf("connection to %s failed. will retry", c.proxyAddr)
 
 			currentDelay = c.retry.nextDelay(currentDelay)
+			if wait, ok := retryAfter(info); ok {
+				currentDelay = wait
+			}
+			c.emit(Event{Kind: EventRetrying, Attempt: attempt, Backoff: currentDelay, RemoteURL: c.proxyAddr, Elapsed: time.Since(start)})
 			backoff = time.After(currentDelay)
 		}
 	}
@@ -207,21 +363,46 @@ func (c *Client) retryConn() (*websocket.Conn, string, error) {
 
 // reconnect is used to repair broken connections
 func (c *Client) reconnect() {
+	start := time.Now()
+
 	c.m.Lock()
 	defer c.m.Unlock()
-	conn, url, err := c.connectWithRetry()
+	defer func() { c.reconnecting = false }()
+
+	if !c.breaker.allow() {
+		c.acceptErr = ErrCircuitOpen
+		return
+	}
+
+	conn, url, attempt, err := c.connectWithRetry()
 	if err != nil {
+		// ErrRetryTimedOut means every attempt still looked retryable
+		// (502/503/504/429, or no response at all) and we simply ran out
+		// of time; ErrAuthFailed/ErrRetryFailed mean the proxy rejected
+		// us outright, which is what the circuit breaker guards against.
+		if err != ErrRetryTimedOut {
+			c.breaker.recordFailure()
+		}
 		// set error and return
 		c.logger.Printf("unable to reconnect to %s", c.proxyAddr)
 		c.acceptErr = ErrRetryFailed
+		c.emit(Event{Kind: EventBroken, Attempt: attempt, RemoteURL: c.proxyAddr, Elapsed: time.Since(start), Err: err})
 		return
 	}
+	c.breaker.recordSuccess()
+
+	c.stopHeartbeatLocked()
 
 	if c.session != nil {
 		_ = c.session.Close()
 		c.session = nil
 	}
 
+	// NOTE: dialHeader above sent reconnectToken (if held), but this is a
+	// no-op scaffold: until wsmux supports resuming a session (see
+	// reconnectTokenHeader's doc comment), reconnecting always means a fresh
+	// wsmux.Session, and every stream that was open on the old session is
+	// lost. Callers should not treat this as working resumption yet.
 	sessionConfig := wsmux.Config{
 		// Log:              c.logger,
 		StreamBufferSize: 4 * 1024,
@@ -231,24 +412,54 @@ func (c *Client) reconnect() {
 	c.state = stateRunning
 	c.logger.Printf("state: running")
 	c.acceptErr = nil
-
+	c.startHeartbeat(conn)
+	c.emit(Event{Kind: EventReconnected, Attempt: attempt, RemoteURL: url, Elapsed: time.Since(start)})
 }
 
-// simple utility to check if client should retry connection
-func shouldRetry(r *http.Response) bool {
-	// may be that proxy is down for changing secrets and therefore unreachable
-	if r == nil {
+// shouldRetry decides, from the proxy's response, whether a failed dial is
+// worth retrying. 502/503/504 are explicitly retryable (the proxy or its
+// upstream is transiently unavailable), as is 429 (rate limited; see
+// retryAfter). Other 4xx responses mean the request itself is bad and
+// retrying won't help; a nil response (no connection at all, e.g. the
+// proxy is down for a secret rotation) is also retried.
+func shouldRetry(info *DialInfo) bool {
+	if info == nil {
+		return true
+	}
+	switch info.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
 		return true
 	}
-	if r.StatusCode/100 == 4 || r.StatusCode/100 == 2 {
+	if info.StatusCode/100 == 4 || info.StatusCode/100 == 2 {
 		return false
 	}
 	return true
 }
 
-func isAuthError(r *http.Response) bool {
-	if r == nil {
+func isAuthError(info *DialInfo) bool {
+	if info == nil {
 		return false
 	}
-	return r.StatusCode == 401
+	return info.StatusCode == http.StatusUnauthorized
+}
+
+// retryAfter reports the delay a 429 response asked us to wait, parsed
+// from its Retry-After header (seconds or an HTTP-date), if present.
+func retryAfter(info *DialInfo) (time.Duration, bool) {
+	if info == nil || info.StatusCode != http.StatusTooManyRequests || info.Header == nil {
+		return 0, false
+	}
+	value := info.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d, true
+		}
+	}
+	return 0, false
 }
@@ -0,0 +1,37 @@
+package whclient
+
+// clientError is a net.Error so it can be stored in Client.acceptErr and
+// returned directly from Accept, which implements net.Listener.
+type clientError struct {
+	msg       string
+	timeout   bool
+	temporary bool
+}
+
+func (e *clientError) Error() string   { return e.msg }
+func (e *clientError) Timeout() bool   { return e.timeout }
+func (e *clientError) Temporary() bool { return e.temporary }
+
+var (
+	// ErrClientClosed is returned by Accept once Close has been called.
+	ErrClientClosed = &clientError{msg: "whclient: client closed"}
+	// ErrClientReconnecting is returned by Accept while a broken
+	// connection is being repaired in the background.
+	ErrClientReconnecting = &clientError{msg: "whclient: client reconnecting", temporary: true}
+	// ErrAuthFailed is returned when the proxy rejects a dial with 401.
+	ErrAuthFailed = &clientError{msg: "whclient: authentication failed"}
+	// ErrRetryFailed is returned when a dial fails with a non-retryable
+	// response, or the configurer itself fails. It is temporary: Client
+	// keeps retrying reconnect in the background (gated by the circuit
+	// breaker), so callers driving Accept in a loop - notably
+	// http.Server.Serve, which treats a non-Temporary Accept error as
+	// fatal and stops - should keep calling Accept rather than give up.
+	ErrRetryFailed = &clientError{msg: "whclient: failed to connect to proxy", temporary: true}
+	// ErrRetryTimedOut is returned when RetryConfig.MaxElapsedTime elapses
+	// while every attempt still failed with a retryable error.
+	ErrRetryTimedOut = &clientError{msg: "whclient: timed out retrying connection to proxy", timeout: true, temporary: true}
+	// ErrCircuitOpen is returned by Accept when the circuit breaker has
+	// opened after repeated non-retryable failures, and the cooldown
+	// period has not yet elapsed.
+	ErrCircuitOpen = &clientError{msg: "whclient: circuit open, not attempting to reconnect", temporary: true}
+)
@@ -0,0 +1,71 @@
+package whclient
+
+import "time"
+
+// EventKind identifies the kind of lifecycle event an Event describes.
+type EventKind int
+
+// Event kinds emitted over the lifetime of a Client's connection to the
+// proxy.
+const (
+	EventDialing EventKind = iota
+	EventConnected
+	EventAuthFailed
+	EventRetrying
+	EventReconnected
+	EventBroken
+	EventClosed
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventDialing:
+		return "dialing"
+	case EventConnected:
+		return "connected"
+	case EventAuthFailed:
+		return "auth_failed"
+	case EventRetrying:
+		return "retrying"
+	case EventReconnected:
+		return "reconnected"
+	case EventBroken:
+		return "broken"
+	case EventClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a single connection lifecycle transition. Config.OnEvent
+// receives one of these for every dial attempt, successful connect,
+// reconnect, and terminal state change, as a typed alternative to scraping
+// Logger output.
+type Event struct {
+	Kind EventKind
+	// Attempt is the 1-indexed dial attempt number within the current
+	// connect/reconnect cycle. Zero when not applicable (e.g. Closed).
+	Attempt int
+	// Backoff is the delay before the next retry, set on EventRetrying.
+	Backoff time.Duration
+	// RemoteURL is the proxy address being dialed or that was connected
+	// to.
+	RemoteURL string
+	// Elapsed is the time spent in the current connect/reconnect cycle so
+	// far, set on EventRetrying, EventReconnected, EventDialing and
+	// EventAuthFailed for retried attempts, and EventBroken when a
+	// reconnect attempt fails.
+	Elapsed time.Duration
+	// Err holds the error associated with the event, if any (e.g. on
+	// EventAuthFailed or EventBroken).
+	Err error
+}
+
+// emit invokes Config.OnEvent if one was configured. It never blocks on the
+// caller-provided handler beyond whatever that handler itself does.
+func (c *Client) emit(ev Event) {
+	if c.onEvent != nil {
+		c.onEvent(ev)
+	}
+}
@@ -0,0 +1,130 @@
+package whclient
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pinger is implemented by transports that support out-of-band ping/pong
+// control frames. *websocket.Conn satisfies it; stream transports such as
+// KCP don't, since they already carry their own link-level keepalive.
+type pinger interface {
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetPingHandler(h func(appData string) error)
+	SetPongHandler(h func(appData string) error)
+}
+
+// startHeartbeat begins sending periodic websocket ping frames over conn
+// and tracks the most recently received pong. If no pong arrives within
+// KeepAliveTimeout of a ping being sent, the connection is considered dead:
+// the client transitions to stateBroken and a reconnect is triggered
+// proactively, mirroring the smux/kcp KeepAliveInterval + KeepAliveTimeout
+// pattern rather than waiting for session.Accept() to eventually error out.
+//
+// Transports that don't support ping/pong control frames (e.g. KCP) are
+// left to their own link-level keepalive; startHeartbeat is then a no-op.
+func (c *Client) startHeartbeat(conn MuxConn) {
+	p, ok := conn.(pinger)
+	if !ok {
+		return
+	}
+
+	c.lastPong.Store(time.Now())
+	p.SetPongHandler(func(string) error {
+		c.lastPong.Store(time.Now())
+		return nil
+	})
+	p.SetPingHandler(func(data string) error {
+		return p.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	stop := make(chan struct{})
+	c.stopHeartbeat = stop
+	go c.heartbeatLoop(p, stop)
+}
+
+// stopHeartbeatLocked stops the running heartbeat goroutine, if any.
+// Callers must hold c.m.
+func (c *Client) stopHeartbeatLocked() {
+	if c.stopHeartbeat != nil {
+		close(c.stopHeartbeat)
+		c.stopHeartbeat = nil
+	}
+}
+
+func (c *Client) heartbeatLoop(conn pinger, stop chan struct{}) {
+	ticker := time.NewTicker(c.keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			pingSentAt := time.Now()
+			deadline := pingSentAt.Add(c.keepAliveInterval)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.logger.Printf("heartbeat: failed to send ping: %v", err)
+				c.markBroken()
+				return
+			}
+			if !c.awaitPong(pingSentAt, stop) {
+				return
+			}
+		}
+	}
+}
+
+// awaitPong polls for a pong newer than pingSentAt on a timer much shorter
+// than KeepAliveTimeout, rather than waiting for heartbeatLoop's next
+// KeepAliveInterval tick to notice one never arrived - otherwise detection
+// could lag up to a full extra KeepAliveInterval behind what
+// KeepAliveTimeout promises. Returns false if the caller should stop (the
+// connection was marked broken, or the heartbeat was told to stop).
+func (c *Client) awaitPong(pingSentAt time.Time, stop chan struct{}) bool {
+	checkInterval := c.keepAliveTimeout / 4
+	if checkInterval <= 0 {
+		checkInterval = time.Millisecond
+	}
+	deadline := pingSentAt.Add(c.keepAliveTimeout)
+
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-c.closed:
+			return false
+		case <-timer.C:
+			if last, ok := c.lastPong.Load().(time.Time); ok && last.After(pingSentAt) {
+				return true
+			}
+			if time.Now().After(deadline) {
+				c.logger.Printf("heartbeat: no pong received within %s, reconnecting", c.keepAliveTimeout)
+				c.markBroken()
+				return false
+			}
+			timer.Reset(checkInterval)
+		}
+	}
+}
+
+// markBroken transitions the client to stateBroken and kicks off a
+// reconnect, as Accept does when session.Accept() errors.
+func (c *Client) markBroken() {
+	c.m.Lock()
+	if c.state == stateClosed {
+		c.m.Unlock()
+		return
+	}
+	c.state = stateBroken
+	c.acceptErr = ErrClientReconnecting
+	c.maybeReconnectLocked()
+	c.m.Unlock()
+
+	c.emit(Event{Kind: EventBroken, RemoteURL: c.proxyAddr})
+}
@@ -0,0 +1,138 @@
+package whclient
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryConfig controls the backoff used by retryConn when reconnecting to
+// the proxy, and the circuit breaker that stops retryConn from hammering a
+// proxy that is consistently rejecting the client outright.
+type RetryConfig struct {
+	InitialDelay   time.Duration
+	MaxDelay       time.Duration
+	Multiplier     float64
+	MaxElapsedTime time.Duration
+
+	// RandomizationFactor adds jitter to every computed delay: the actual
+	// delay is chosen uniformly from the range
+	// [(1-RandomizationFactor)*delay, (1+RandomizationFactor)*delay].
+	// 1 gives full jitter (AWS's "FullJitter" backoff-and-jitter
+	// guidance). Defaults to defaultRandomizationFactor if zero; to
+	// disable jitter entirely (an explicit 0 can't be told apart from an
+	// unset field), set DisableJitter instead. Without jitter, a
+	// mass-reconnect event (e.g. a proxy restart) has every client wake
+	// at the same instant and thundering-herds the proxy.
+	RandomizationFactor float64
+
+	// DisableJitter turns off jitter entirely, regardless of
+	// RandomizationFactor. Useful for tests that need deterministic
+	// backoff timing.
+	DisableJitter bool
+
+	// CircuitBreaker configures when Client stops dialing altogether for
+	// a cooldown period after repeated non-retryable failures.
+	CircuitBreaker CircuitBreakerConfig
+}
+
+const (
+	defaultInitialDelay        = 2 * time.Second
+	defaultMaxDelay            = 60 * time.Second
+	defaultMultiplier          = 1.5
+	defaultMaxElapsedTime      = 5 * time.Minute
+	defaultRandomizationFactor = 0.5
+)
+
+// defaultValues fills in zero fields with this package's defaults.
+func (r RetryConfig) defaultValues() RetryConfig {
+	if r.InitialDelay <= 0 {
+		r.InitialDelay = defaultInitialDelay
+	}
+	if r.MaxDelay <= 0 {
+		r.MaxDelay = defaultMaxDelay
+	}
+	if r.Multiplier <= 0 {
+		r.Multiplier = defaultMultiplier
+	}
+	if r.MaxElapsedTime <= 0 {
+		r.MaxElapsedTime = defaultMaxElapsedTime
+	}
+	if r.RandomizationFactor <= 0 {
+		r.RandomizationFactor = defaultRandomizationFactor
+	}
+	r.CircuitBreaker = r.CircuitBreaker.defaultValues()
+	return r
+}
+
+// initialBackoff is the (jittered) delay before the first retry attempt.
+func (r RetryConfig) initialBackoff() time.Duration {
+	if r.DisableJitter {
+		return r.InitialDelay
+	}
+	return jitter(r.InitialDelay, r.RandomizationFactor)
+}
+
+// nextDelay returns the jittered delay to use for the attempt after
+// current, applying exponential backoff capped at MaxDelay.
+func (r RetryConfig) nextDelay(current time.Duration) time.Duration {
+	next := time.Duration(float64(current) * r.Multiplier)
+	if next > r.MaxDelay {
+		next = r.MaxDelay
+	}
+	if r.DisableJitter {
+		return next
+	}
+	return jitter(next, r.RandomizationFactor)
+}
+
+// jitter applies AWS-style "full jitter" (or a fraction of it, depending on
+// factor) to d: the result is chosen uniformly from
+// [(1-factor)*d, (1+factor)*d].
+func jitter(d time.Duration, factor float64) time.Duration {
+	if factor <= 0 {
+		return d
+	}
+	if factor > 1 {
+		factor = 1
+	}
+	delta := float64(d) * factor
+	lo := float64(d) - delta
+	spread := 2 * delta
+	return time.Duration(lo + rand.Float64()*spread)
+}
+
+// CircuitBreakerConfig configures Client's circuit breaker, which stops
+// retryConn from dialing at all for a cooldown period after repeated
+// consecutive non-retryable failures (auth failures, or 4xx responses
+// shouldRetry refuses to retry).
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive non-retryable
+	// failures within Window that opens the circuit.
+	FailureThreshold int
+	// Window bounds how long a failure streak is tracked over; a failure
+	// arriving more than Window after the streak's first failure starts a
+	// new streak.
+	Window time.Duration
+	// CooldownPeriod is how long the circuit stays open before a single
+	// half-open probe dial is allowed through.
+	CooldownPeriod time.Duration
+}
+
+const (
+	defaultFailureThreshold = 5
+	defaultWindow           = time.Minute
+	defaultCooldownPeriod   = 30 * time.Second
+)
+
+func (c CircuitBreakerConfig) defaultValues() CircuitBreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	if c.Window <= 0 {
+		c.Window = defaultWindow
+	}
+	if c.CooldownPeriod <= 0 {
+		c.CooldownPeriod = defaultCooldownPeriod
+	}
+	return c
+}
@@ -0,0 +1,93 @@
+package whclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryConfigDefaultValues(t *testing.T) {
+	r := RetryConfig{}.defaultValues()
+	if r.InitialDelay != defaultInitialDelay {
+		t.Errorf("InitialDelay = %v, want %v", r.InitialDelay, defaultInitialDelay)
+	}
+	if r.MaxDelay != defaultMaxDelay {
+		t.Errorf("MaxDelay = %v, want %v", r.MaxDelay, defaultMaxDelay)
+	}
+	if r.Multiplier != defaultMultiplier {
+		t.Errorf("Multiplier = %v, want %v", r.Multiplier, defaultMultiplier)
+	}
+	if r.RandomizationFactor != defaultRandomizationFactor {
+		t.Errorf("RandomizationFactor = %v, want %v", r.RandomizationFactor, defaultRandomizationFactor)
+	}
+}
+
+func TestRetryConfigNextDelayCapsAtMaxDelay(t *testing.T) {
+	r := RetryConfig{
+		MaxDelay:      5 * time.Second,
+		Multiplier:    2,
+		DisableJitter: true,
+	}
+	got := r.nextDelay(4 * time.Second)
+	if got != 5*time.Second {
+		t.Errorf("nextDelay(4s) = %v, want %v (capped at MaxDelay)", got, r.MaxDelay)
+	}
+}
+
+func TestRetryConfigNextDelayAppliesMultiplier(t *testing.T) {
+	r := RetryConfig{
+		MaxDelay:      time.Minute,
+		Multiplier:    1.5,
+		DisableJitter: true,
+	}
+	got := r.nextDelay(2 * time.Second)
+	want := 3 * time.Second
+	if got != want {
+		t.Errorf("nextDelay(2s) = %v, want %v", got, want)
+	}
+}
+
+func TestRetryConfigDisableJitter(t *testing.T) {
+	r := RetryConfig{
+		InitialDelay:        time.Second,
+		MaxDelay:            time.Minute,
+		Multiplier:          2,
+		RandomizationFactor: 0.5,
+		DisableJitter:       true,
+	}
+	if got := r.initialBackoff(); got != r.InitialDelay {
+		t.Errorf("initialBackoff() = %v, want %v unmodified (DisableJitter set)", got, r.InitialDelay)
+	}
+	if got := r.nextDelay(time.Second); got != 2*time.Second {
+		t.Errorf("nextDelay(1s) = %v, want 2s unmodified (DisableJitter set)", got)
+	}
+}
+
+func TestJitterWithinBounds(t *testing.T) {
+	d := time.Second
+	factor := 0.5
+	for i := 0; i < 100; i++ {
+		got := jitter(d, factor)
+		lo := time.Duration(float64(d) * (1 - factor))
+		hi := time.Duration(float64(d) * (1 + factor))
+		if got < lo || got > hi {
+			t.Fatalf("jitter(%v, %v) = %v, want within [%v, %v]", d, factor, got, lo, hi)
+		}
+	}
+}
+
+func TestJitterZeroFactorDisablesJitter(t *testing.T) {
+	d := 3 * time.Second
+	if got := jitter(d, 0); got != d {
+		t.Errorf("jitter(%v, 0) = %v, want %v unmodified", d, got, d)
+	}
+}
+
+func TestJitterFactorAboveOneIsClamped(t *testing.T) {
+	d := time.Second
+	for i := 0; i < 100; i++ {
+		got := jitter(d, 2)
+		if got < 0 || got > 2*d {
+			t.Fatalf("jitter(%v, 2) = %v, want within [0, %v] (factor clamped to 1)", d, got, 2*d)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package whclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+// AccessLogEntry describes a single request proxied by Serve, for use with
+// ServeOptions.AccessLog.
+type AccessLogEntry struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// ServeOptions configures Serve.
+type ServeOptions struct {
+	// Configurer is used to create the Client that accepts tunneled
+	// streams, unless Client is already set.
+	Configurer Configurer
+	// Client, if set, is used instead of creating a new one from
+	// Configurer. Serve does not close it.
+	Client *Client
+
+	// HostHeader, if set, overrides the Host header sent to the backend.
+	// If empty, the Host header from the incoming request is forwarded
+	// unchanged.
+	HostHeader string
+	// InsecureSkipVerify disables TLS certificate verification when the
+	// backend URL uses https. Only useful for backends with self-signed
+	// certificates on a trusted local network.
+	InsecureSkipVerify bool
+	// RequestTimeout bounds how long Serve waits for the backend to
+	// respond to a single proxied request. Zero means no timeout.
+	RequestTimeout time.Duration
+	// AccessLog, if set, is called once per proxied request after the
+	// backend has responded (or failed).
+	AccessLog func(AccessLogEntry)
+}
+
+// Serve accepts tunneled streams from the proxy, parses them as HTTP
+// requests, and reverse-proxies each one to backendURL. backendURL may use
+// the http, https, or unix scheme; a unix backendURL's path is the socket
+// path, e.g. "unix:///var/run/myapp.sock".
+//
+// This mirrors the "expose localhost:8080 to the world" pattern: it lets
+// callers adopt webhooktunnel without writing any Go glue around Client.
+func Serve(backendURL string, opts ServeOptions) error {
+	client := opts.Client
+	if client == nil {
+		if opts.Configurer == nil {
+			return fmt.Errorf("whclient: Serve requires ServeOptions.Client or ServeOptions.Configurer")
+		}
+		c, err := New(opts.Configurer)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		client = c
+	}
+
+	proxy, err := newReverseProxy(backendURL, opts)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: proxy}
+	return server.Serve(client)
+}
+
+func newReverseProxy(backendURL string, opts ServeOptions) (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(backendURL)
+	if err != nil {
+		return nil, fmt.Errorf("whclient: invalid backend URL %q: %w", backendURL, err)
+	}
+
+	transport := &http.Transport{}
+	scheme := target.Scheme
+	host := target.Host
+
+	if target.Scheme == "unix" {
+		socketPath := target.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+		scheme = "http"
+		host = "unix"
+	} else if opts.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			*req = *req.WithContext(context.WithValue(req.Context(), startTimeKey, time.Now()))
+			req.URL.Scheme = scheme
+			req.URL.Host = host
+			if opts.HostHeader != "" {
+				req.Host = opts.HostHeader
+			}
+		},
+		Transport: transport,
+	}
+
+	if opts.RequestTimeout > 0 {
+		proxy.Transport = &timeoutTransport{base: transport, timeout: opts.RequestTimeout}
+	}
+
+	if opts.AccessLog != nil {
+		proxy.ModifyResponse = func(res *http.Response) error {
+			opts.AccessLog(AccessLogEntry{
+				Method:     res.Request.Method,
+				Path:       res.Request.URL.Path,
+				StatusCode: res.StatusCode,
+				Duration:   requestDuration(res.Request),
+			})
+			return nil
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+			opts.AccessLog(AccessLogEntry{
+				Method:   req.Method,
+				Path:     req.URL.Path,
+				Duration: requestDuration(req),
+				Err:      err,
+			})
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+
+	return proxy, nil
+}
+
+type ctxKey int
+
+const startTimeKey ctxKey = iota
+
+func requestDuration(req *http.Request) time.Duration {
+	start, ok := req.Context().Value(startTimeKey).(time.Time)
+	if !ok {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// timeoutTransport wraps an http.RoundTripper with a fixed per-request
+// deadline, since http.Transport itself has no single "whole round trip"
+// timeout knob.
+type timeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	req = req.WithContext(ctx)
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelOnCloseBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelOnCloseBody releases the timeout context once the response body is
+// fully consumed, rather than on RoundTrip return.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
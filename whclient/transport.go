@@ -0,0 +1,82 @@
+package whclient
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// MuxConn is the connection type wsmux operates on. *websocket.Conn
+// satisfies it directly; other transports wrap their raw stream to
+// present the same framed-message interface so wsmux.Client/wsmux.Server
+// stay transport-agnostic.
+type MuxConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// DialInfo carries the metadata a websocket upgrade response would have
+// included (the client URL and reconnect token headers), independent of
+// whether the transport that produced the connection actually speaks HTTP.
+type DialInfo struct {
+	StatusCode int
+	Header     http.Header
+}
+
+// Transport dials the proxy over some underlying network protocol and
+// returns a connection wsmux can multiplex streams over. whclient ships
+// two implementations: the default gorilla-websocket transport, and an
+// opt-in KCP-over-UDP transport for lossy links.
+type Transport interface {
+	// Name identifies the transport, e.g. for logging and Config.Transport
+	// selection.
+	Name() string
+	// Dial connects to addr, sending header as the handshake metadata (at
+	// minimum the Authorization and x-webhooktunnel-* headers), and
+	// returns the established MuxConn plus response metadata.
+	Dial(addr string, header http.Header) (MuxConn, *DialInfo, error)
+}
+
+// newTransport selects a Transport implementation based on config.Transport.
+// An empty value selects the websocket transport, which is the default and
+// the only transport whclient has supported historically.
+func newTransport(config Config) (Transport, error) {
+	switch config.Transport {
+	case "", TransportWebsocket:
+		return &wsTransport{}, nil
+	case TransportKCP:
+		return newKCPTransport(config.KCP)
+	default:
+		return nil, fmt.Errorf("whclient: unknown transport %q", config.Transport)
+	}
+}
+
+// Transport name constants usable as Config.Transport.
+const (
+	TransportWebsocket = "websocket"
+	TransportKCP       = "kcp"
+)
+
+// wsTransport is the original, default Transport: a websocket connection
+// dialed with gorilla/websocket. *websocket.Conn already satisfies MuxConn.
+type wsTransport struct{}
+
+func (t *wsTransport) Name() string { return TransportWebsocket }
+
+func (t *wsTransport) Dial(addr string, header http.Header) (MuxConn, *DialInfo, error) {
+	conn, res, err := websocket.DefaultDialer.Dial(addr, header)
+	info := infoFromResponse(res)
+	if err != nil {
+		return nil, info, err
+	}
+	return conn, info, nil
+}
+
+func infoFromResponse(res *http.Response) *DialInfo {
+	if res == nil {
+		return nil
+	}
+	return &DialInfo{StatusCode: res.StatusCode, Header: res.Header}
+}
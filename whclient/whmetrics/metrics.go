@@ -0,0 +1,117 @@
+// Package whmetrics exposes Prometheus collectors for a whclient.Client's
+// connection lifecycle, so operators running many tunnels can see flapping
+// clients and build SLOs/alerting instead of grepping Logger output.
+package whmetrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/taskcluster/webhooktunnel/whclient"
+)
+
+// Metrics bundles the Prometheus collectors for a single whclient.Client.
+// Use New to create one, register its Collectors with a
+// prometheus.Registerer, and pass OnEvent as Config.OnEvent.
+type Metrics struct {
+	ConnectionState *prometheus.GaugeVec
+	Reconnects      prometheus.Counter
+	RetryAttempts   prometheus.Histogram
+	// ActiveStreams is not wired up automatically: whclient.Client does
+	// not currently expose the underlying wsmux.Session's open-stream
+	// count, so callers with access to that (e.g. via their own Session
+	// bookkeeping) should Set it directly.
+	ActiveStreams prometheus.Gauge
+	BytesIn       prometheus.Counter
+	BytesOut      prometheus.Counter
+}
+
+// connectionStates lists every Event kind in the order their labels are
+// reset on each OnEvent call, so ConnectionState always reflects exactly
+// one active state.
+var connectionStates = []string{
+	whclient.EventDialing.String(),
+	whclient.EventConnected.String(),
+	whclient.EventAuthFailed.String(),
+	whclient.EventRetrying.String(),
+	whclient.EventReconnected.String(),
+	whclient.EventBroken.String(),
+	whclient.EventClosed.String(),
+}
+
+// New creates a Metrics bundle. constLabels (e.g. {"client_id": id}) are
+// applied to every collector, so metrics from multiple tunnels on the same
+// process can be told apart.
+func New(constLabels prometheus.Labels) *Metrics {
+	return &Metrics{
+		ConnectionState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   "whclient",
+			Name:        "connection_state",
+			Help:        "1 for the event kind most recently observed, 0 for all others, labelled by state.",
+			ConstLabels: constLabels,
+		}, []string{"state"}),
+		Reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "whclient",
+			Name:        "reconnects_total",
+			Help:        "Number of times Client successfully reconnected to the proxy.",
+			ConstLabels: constLabels,
+		}),
+		RetryAttempts: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "whclient",
+			Name:        "retry_attempts",
+			Help:        "Dial attempts taken to (re)establish a connection.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.LinearBuckets(1, 1, 10),
+		}),
+		ActiveStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "whclient",
+			Name:        "active_streams",
+			Help:        "Multiplexed streams currently open on the tunnel.",
+			ConstLabels: constLabels,
+		}),
+		BytesIn: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "whclient",
+			Name:        "bytes_in_total",
+			Help:        "Bytes read from the tunnel transport.",
+			ConstLabels: constLabels,
+		}),
+		BytesOut: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "whclient",
+			Name:        "bytes_out_total",
+			Help:        "Bytes written to the tunnel transport.",
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+// Collectors returns every collector in m, for one-line registration:
+// prometheus.MustRegister(m.Collectors()...).
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.ConnectionState,
+		m.Reconnects,
+		m.RetryAttempts,
+		m.ActiveStreams,
+		m.BytesIn,
+		m.BytesOut,
+	}
+}
+
+// OnEvent updates ConnectionState, Reconnects and RetryAttempts from a
+// whclient.Event stream. Pass it directly as whclient.Config.OnEvent.
+func (m *Metrics) OnEvent(ev whclient.Event) {
+	active := ev.Kind.String()
+	for _, state := range connectionStates {
+		v := 0.0
+		if state == active {
+			v = 1
+		}
+		m.ConnectionState.WithLabelValues(state).Set(v)
+	}
+
+	switch ev.Kind {
+	case whclient.EventConnected:
+		m.RetryAttempts.Observe(float64(ev.Attempt))
+	case whclient.EventReconnected:
+		m.Reconnects.Inc()
+		m.RetryAttempts.Observe(float64(ev.Attempt))
+	}
+}
@@ -0,0 +1,78 @@
+package whmetrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/taskcluster/webhooktunnel/whclient"
+)
+
+// WrapTransport wraps t so that every byte read from or written to the
+// dialed connection is counted against m.BytesIn/m.BytesOut. Pass the
+// method value m.WrapTransport as whclient.Config.TransportWrapper (or call
+// it directly on a Transport you already have).
+func (m *Metrics) WrapTransport(t whclient.Transport) whclient.Transport {
+	return &countingTransport{base: t, metrics: m}
+}
+
+type countingTransport struct {
+	base    whclient.Transport
+	metrics *Metrics
+}
+
+func (t *countingTransport) Name() string { return t.base.Name() }
+
+func (t *countingTransport) Dial(addr string, header http.Header) (whclient.MuxConn, *whclient.DialInfo, error) {
+	conn, info, err := t.base.Dial(addr, header)
+	if err != nil {
+		return nil, info, err
+	}
+	cc := &countingConn{MuxConn: conn, metrics: t.metrics}
+	// conn may additionally support ping/pong control frames (the
+	// websocket transport does); countingConn on its own only promotes
+	// whclient.MuxConn's methods, which would silently drop those and
+	// disable whclient's dead-peer heartbeat for any wrapped transport.
+	// Preserve them by returning a type that also embeds pinger when the
+	// wrapped conn has it.
+	if p, ok := conn.(pinger); ok {
+		return &pingerCountingConn{countingConn: cc, pinger: p}, info, nil
+	}
+	return cc, info, nil
+}
+
+// pinger mirrors whclient's unexported ping/pong control-frame interface
+// (see heartbeat.go) structurally, since countingConn needs to detect and
+// forward it without importing an unexported type.
+type pinger interface {
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetPingHandler(h func(appData string) error)
+	SetPongHandler(h func(appData string) error)
+}
+
+// countingConn wraps a whclient.MuxConn to tally bytes read/written.
+type countingConn struct {
+	whclient.MuxConn
+	metrics *Metrics
+}
+
+func (c *countingConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.MuxConn.ReadMessage()
+	c.metrics.BytesIn.Add(float64(len(data)))
+	return messageType, data, err
+}
+
+func (c *countingConn) WriteMessage(messageType int, data []byte) error {
+	err := c.MuxConn.WriteMessage(messageType, data)
+	if err == nil {
+		c.metrics.BytesOut.Add(float64(len(data)))
+	}
+	return err
+}
+
+// pingerCountingConn is a countingConn whose wrapped conn also supports
+// ping/pong control frames. Embedding both lets it satisfy whclient's
+// pinger type assertion in addition to whclient.MuxConn.
+type pingerCountingConn struct {
+	*countingConn
+	pinger
+}